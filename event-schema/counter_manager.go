@@ -1,26 +1,44 @@
 package event_schema
 
-// schemaHash -> Key -> FrequencyCounter
-var countersCache map[string]map[string]*FrequencyCounter
+import "sort"
+
+// counters is the concurrency-safe registry backing every package-level
+// frequency-counter function below.
+var counters = newCountersRegistry()
 
 type CounterItem struct {
 	Value     string
 	Frequency float64
 }
 
-func init() {
-	if countersCache == nil {
-		countersCache = make(map[string]map[string]*FrequencyCounter)
-	}
+// PrivateDataT is the JSON payload stored alongside an event model that
+// doesn't belong in its public schema. Today that's just the bounded,
+// per-key frequency counters backing the Space-Saving summary for the
+// model's schemaHash.
+type PrivateDataT struct {
+	FrequencyCounters []*FrequencyCounter `json:"frequency_counters"`
 }
 
 // populateFrequencyCountersBounded is responsible for capturing the frequency counters which
 // are available in the db and store them in memory but in a bounded manner.
+//
+// The persisted counters are sorted by their guaranteed lower-bound count
+// (Count-Error) before trimming to bound, so a reload keeps the bound keys
+// with the highest guaranteed counts rather than whichever bound of them
+// happened to be first in the slice - Count and Error travel with each counter, so the Space-Saving
+// min-count pointer is implicitly rebuilt: the first eviction after reload
+// simply rescans the (small, bounded) map for the new minimum.
 func populateFrequencyCountersBounded(schemaHash string, frequencyCounters []*FrequencyCounter, bound int) {
+	sorted := make([]*FrequencyCounter, len(frequencyCounters))
+	copy(sorted, frequencyCounters)
+	sort.Slice(sorted, func(i, j int) bool {
+		return (sorted[i].Count - sorted[i].Error) > (sorted[j].Count - sorted[j].Error)
+	})
+
 	frequencyCountersMap := make(map[string]*FrequencyCounter)
 	count := 0
 
-	for _, fc := range frequencyCounters {
+	for _, fc := range sorted {
 		// If count exceeds for a particular schema hash, break
 		// the loop
 		if count >= bound {
@@ -30,7 +48,13 @@ func populateFrequencyCountersBounded(schemaHash string, frequencyCounters []*Fr
 		frequencyCountersMap[fc.Name] = NewPeristedFrequencyCounter(fc)
 		count++
 	}
-	countersCache[schemaHash] = frequencyCountersMap
+	counters.Replace(schemaHash, frequencyCountersMap)
+
+	// The in-memory set for schemaHash was just rebuilt from scratch, so any
+	// gauge this package emits for it is stale until the events that follow
+	// repopulate it - reset it rather than let it keep reporting whatever a
+	// previous load cycle (or a crashed predecessor process) left behind.
+	resetSchemaMetrics(schemaHash)
 }
 
 // populateFrequencyCounters is responsible for capturing the frequency counters
@@ -41,73 +65,53 @@ func populateFrequencyCounters(schemaHash string, frequencyCounters []*Frequency
 }
 
 func getAllFrequencyCounters(schemaHash string) []*FrequencyCounter {
-	schemaVersionCounters, ok := countersCache[schemaHash]
-	if !ok {
-		return []*FrequencyCounter{}
-	}
-
-	frequencyCounters := make([]*FrequencyCounter, 0, len(schemaVersionCounters))
-
-	for _, v := range schemaVersionCounters {
-		frequencyCounters = append(frequencyCounters, v)
-	}
-	return frequencyCounters
+	return counters.Snapshot(schemaHash)
 }
 
+// getFrequencyCounterBounded returns the FrequencyCounter for key within
+// schemaHash, admitting it into the tracked set if there's room. Once
+// schemaHash has bound distinct keys, an unseen key is only admitted by
+// evicting the least-frequent tracked key - a Space-Saving top-K summary
+// (Metwally, Agrawal, El Abbadi, "Efficient Computation of Frequent and
+// Top-K Elements in Data Streams") - instead of the random key Go's map
+// iteration would otherwise pick. The evicted key's count and the error it
+// introduces are inherited by the new key, so Count-Error stays a
+// guaranteed lower bound on the true observation count (see
+// itemsAboveThreshold).
 func getFrequencyCounterBounded(schemaHash string, key string, bound int) *FrequencyCounter {
-
-	schemaVersionCounters, ok := countersCache[schemaHash]
-	if !ok {
-		schemaVersionCounters = make(map[string]*FrequencyCounter)
-		countersCache[schemaHash] = schemaVersionCounters
-	}
-
-	diff := bound - len(schemaVersionCounters)
-	// bound reached, not allowed adding more values.
-	if diff == 0 {
-		// Just check and return value from the map
-		// no need to add anything to it.
-		return schemaVersionCounters[key]
-	}
-
-	// If we have exceeded the bound, we need to trim it
-	// to the new bound. This way whatever we have stored in memory
-	// gets purged which will be flushed back to the database on a schedule.
-	if diff < 0 {
-
-		toDelete := -1 * diff
-		for k := range schemaVersionCounters {
-			if toDelete > 0 {
-				delete(schemaVersionCounters, k)
-				toDelete--
-			} else {
-				break
-			}
-		}
-
-		// Once the values are trimmed, simply return the lookup
-		return schemaVersionCounters[key]
-	}
-
-	// Here we add a new frequency counter for schemaVersionCounter
-	frequencyCounter, ok := schemaVersionCounters[key]
-	if !ok {
-		frequencyCounter = NewFrequencyCounter(key)
-		schemaVersionCounters[key] = frequencyCounter
-	}
-
-	return frequencyCounter
+	return counters.GetOrCreate(schemaHash, key, bound)
 }
 
 func getFrequencyCounter(schemaHash string, key string) *FrequencyCounter {
 	return getFrequencyCounterBounded(schemaHash, key, frequencyCounterLimit)
 }
 
+// observeFrequencyCounter records one occurrence of value for key within
+// schemaHash, admitting key into the tracked set first if needed. Unlike
+// getFrequencyCounterBounded, which hands back a pointer for the caller to
+// mutate, this performs the get-or-create and the mutation atomically under
+// the registry's shard lock, so concurrent handleEvent calls for the same
+// schemaHash can't race on the counter's Values map.
+func observeFrequencyCounter(schemaHash, key, value string) {
+	counters.Observe(schemaHash, key, value, frequencyCounterLimit)
+}
+
+// itemsAboveThreshold returns, for every key currently retained in the
+// Space-Saving summary for schemaHash, its guaranteed lower-bound count
+// (Count-Error). A key this returns was truly observed at least that many
+// times; a key evicted from the summary is simply absent.
+func itemsAboveThreshold(schemaHash string) map[string]int64 {
+	result := make(map[string]int64)
+	for _, fc := range counters.Snapshot(schemaHash) {
+		result[fc.Name] = fc.Count - fc.Error
+	}
+	return result
+}
+
 func getSchemaVersionCounters(schemaHash string) map[string][]*CounterItem {
-	schemaVersionCounters := countersCache[schemaHash]
-	counters := make(map[string][]*CounterItem)
+	result := make(map[string][]*CounterItem)
 
-	for key, fc := range schemaVersionCounters {
+	for _, fc := range counters.Snapshot(schemaHash) {
 
 		entries := fc.ItemsAboveThreshold()
 		counterItems := make([]*CounterItem, 0, len(entries))
@@ -122,8 +126,8 @@ func getSchemaVersionCounters(schemaHash string) map[string][]*CounterItem {
 		}
 
 		if len(counterItems) > 0 {
-			counters[key] = counterItems
+			result[fc.Name] = counterItems
 		}
 	}
-	return counters
+	return result
 }
@@ -0,0 +1,152 @@
+package event_schema
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// countersShardCount is the number of independent locks countersRegistry
+// spreads schemaHashes across. 32 is large enough that unrelated schemas
+// rarely contend while staying small enough that Snapshot/Replace callers
+// don't need to reason about per-shard behaviour.
+const countersShardCount = 32
+
+type counterShard struct {
+	mu    sync.RWMutex
+	cache map[string]map[string]*FrequencyCounter // schemaHash -> key -> FrequencyCounter
+}
+
+// countersRegistry is a concurrency-safe, sharded replacement for a bare
+// schemaHash -> key -> FrequencyCounter map. handleEvent is called from
+// many goroutines at once across many write keys, so a single shared map
+// and lock would serialize unrelated schemas; sharding on schemaHash lets
+// them proceed independently.
+type countersRegistry struct {
+	shards [countersShardCount]*counterShard
+}
+
+func newCountersRegistry() *countersRegistry {
+	r := &countersRegistry{}
+	for i := range r.shards {
+		r.shards[i] = &counterShard{cache: make(map[string]map[string]*FrequencyCounter)}
+	}
+	return r
+}
+
+func (r *countersRegistry) shardFor(schemaHash string) *counterShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(schemaHash))
+	return r.shards[h.Sum32()%countersShardCount]
+}
+
+// Get returns the FrequencyCounter tracked for key within schemaHash, or nil
+// if key isn't currently tracked.
+func (r *countersRegistry) Get(schemaHash, key string) *FrequencyCounter {
+	shard := r.shardFor(schemaHash)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.cache[schemaHash][key]
+}
+
+// GetOrCreate returns the FrequencyCounter for key within schemaHash,
+// admitting it into the tracked set (evicting the least-frequent entry via
+// the Space-Saving rule once bound is reached) if it isn't tracked yet.
+//
+// The returned pointer is shared with the registry: callers must not read
+// or write its fields after this call returns, since another goroutine's
+// GetOrCreate/Observe for the same schemaHash can concurrently mutate it
+// the moment the shard lock below is released. Use Observe to record a
+// value against it, and Snapshot (which deep-copies) to read it.
+func (r *countersRegistry) GetOrCreate(schemaHash, key string, bound int) *FrequencyCounter {
+	shard := r.shardFor(schemaHash)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return getOrCreateLocked(shard, schemaHash, key, bound)
+}
+
+// Observe records one occurrence of value for key within schemaHash,
+// admitting key into the tracked set first if needed. The whole
+// get-or-create-and-mutate sequence happens under the owning shard's lock,
+// so concurrent handleEvent calls across workers can't race on the same
+// FrequencyCounter's Values map.
+func (r *countersRegistry) Observe(schemaHash, key, value string, bound int) {
+	shard := r.shardFor(schemaHash)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	getOrCreateLocked(shard, schemaHash, key, bound).Observe(value)
+}
+
+// getOrCreateLocked implements GetOrCreate's admission logic; callers must
+// already hold shard.mu.
+func getOrCreateLocked(shard *counterShard, schemaHash, key string, bound int) *FrequencyCounter {
+	schemaVersionCounters, ok := shard.cache[schemaHash]
+	if !ok {
+		schemaVersionCounters = make(map[string]*FrequencyCounter)
+		shard.cache[schemaHash] = schemaVersionCounters
+	}
+
+	// A bound lowered since the set was filled (frequencyCounterLimit can
+	// change at runtime) trims the least-frequent tracked keys until the set
+	// fits it again.
+	for len(schemaVersionCounters) > 0 && len(schemaVersionCounters) > bound {
+		delete(schemaVersionCounters, minCountFrequencyCounter(schemaVersionCounters).Name)
+	}
+
+	if frequencyCounter, ok := schemaVersionCounters[key]; ok {
+		frequencyCounter.Count++
+		return frequencyCounter
+	}
+
+	if len(schemaVersionCounters) < bound {
+		frequencyCounter := NewFrequencyCounter(key)
+		frequencyCounter.Count = 1
+		schemaVersionCounters[key] = frequencyCounter
+		return frequencyCounter
+	}
+
+	evict := minCountFrequencyCounter(schemaVersionCounters)
+	delete(schemaVersionCounters, evict.Name)
+
+	frequencyCounter := NewFrequencyCounter(key)
+	frequencyCounter.Count = evict.Count + 1
+	frequencyCounter.Error = evict.Count
+	schemaVersionCounters[key] = frequencyCounter
+	return frequencyCounter
+}
+
+// Snapshot returns a deep copy of the FrequencyCounters currently tracked
+// for schemaHash. Because the copy happens under the same shard lock that
+// guards GetOrCreate/Observe, the result is safe to read freely afterwards
+// even while ingestion for schemaHash continues concurrently.
+func (r *countersRegistry) Snapshot(schemaHash string) []*FrequencyCounter {
+	shard := r.shardFor(schemaHash)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	schemaVersionCounters := shard.cache[schemaHash]
+	out := make([]*FrequencyCounter, 0, len(schemaVersionCounters))
+	for _, fc := range schemaVersionCounters {
+		out = append(out, fc.clone())
+	}
+	return out
+}
+
+// Replace overwrites the tracked set for schemaHash wholesale, as happens
+// when populateFrequencyCountersBounded reloads a schema's counters from
+// the DB.
+func (r *countersRegistry) Replace(schemaHash string, counters map[string]*FrequencyCounter) {
+	shard := r.shardFor(schemaHash)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.cache[schemaHash] = counters
+}
+
+func minCountFrequencyCounter(schemaVersionCounters map[string]*FrequencyCounter) *FrequencyCounter {
+	var least *FrequencyCounter
+	for _, fc := range schemaVersionCounters {
+		if least == nil || fc.Count < least.Count {
+			least = fc
+		}
+	}
+	return least
+}
@@ -0,0 +1,53 @@
+package event_schema
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestCountersRegistryConcurrentAccess races many goroutines against
+// countersRegistry across both overlapping and disjoint schemaHashes, the
+// same access pattern concurrent handleEvent calls produce in production.
+// Goroutines sharing a schemaHash also share keys, so Observe calls land on
+// the exact same *FrequencyCounter concurrently - the case that used to
+// race on its Values map before Observe started locking the shard itself.
+// Run with -race: a bare, unsynchronized map (or an Observe outside the
+// shard lock) would corrupt here.
+func TestCountersRegistryConcurrentAccess(t *testing.T) {
+	const (
+		goroutines         = 64
+		iterationsPerGo    = 200
+		overlappingSchemas = 4
+	)
+
+	registry := newCountersRegistry()
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+
+			// Half the goroutines contend on a small, shared set of
+			// schemaHashes; the other half each own a disjoint schemaHash.
+			var schemaHash string
+			if g%2 == 0 {
+				schemaHash = fmt.Sprintf("shared-schema-%d", (g/2)%overlappingSchemas)
+			} else {
+				schemaHash = fmt.Sprintf("disjoint-schema-%d", g)
+			}
+
+			for i := 0; i < iterationsPerGo; i++ {
+				key := fmt.Sprintf("key-%d", i%20)
+				registry.GetOrCreate(schemaHash, key, 10)
+				registry.Get(schemaHash, key)
+				registry.Observe(schemaHash, key, fmt.Sprintf("value-%d", i%5), 10)
+				registry.Snapshot(schemaHash)
+			}
+			registry.Replace(schemaHash, map[string]*FrequencyCounter{})
+		}(g)
+	}
+
+	wg.Wait()
+}
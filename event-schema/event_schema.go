@@ -0,0 +1,283 @@
+package event_schema
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jeremywohl/flatten"
+)
+
+// WriteKey identifies the source a batch of events was sent under.
+type WriteKey string
+
+// SingularEventT is a single event out of an EventPayloadT batch.
+type SingularEventT map[string]interface{}
+
+// EventPayloadT is the outer batch payload handleEvent is fed events from.
+type EventPayloadT struct {
+	Batch []SingularEventT `json:"batch"`
+}
+
+// EventModelT is the event model rudder-server has inferred for one
+// (writeKey, eventType, eventIdentifier) triple.
+type EventModelT struct {
+	UUID            string
+	WriteKey        WriteKey
+	EventType       string
+	EventIdentifier string
+}
+
+// EventModelMapT indexes EventModelT by writeKey -> eventType -> eventIdentifier.
+type EventModelMapT map[WriteKey]map[string]map[string]*EventModelT
+
+// SchemaVersionT is one observed schema (shape) of an EventModelT.
+type SchemaVersionT struct {
+	UUID         string
+	EventModelID string
+	SchemaHash   string
+	Schema       json.RawMessage
+}
+
+// SchemaVersionMapT indexes SchemaVersionT by eventModelID -> schemaHash.
+type SchemaVersionMapT map[string]map[string]*SchemaVersionT
+
+// EventSchemaManagerT owns one set of in-memory event-model and
+// schema-version state, populated by handleEvent and flushed to Postgres by
+// flushEventSchemasToDB. A ShardedEventSchemaManagerT (see
+// sharded_manager.go) owns several of these, one per shard, so that
+// ingestion for distinct event models can proceed in parallel.
+type EventSchemaManagerT struct {
+	dbHandle             *sql.DB
+	disableInMemoryCache bool
+
+	eventModelMapLock sync.RWMutex
+	eventModelMap     EventModelMapT
+
+	schemaVersionMapLock sync.RWMutex
+	schemaVersionMap     SchemaVersionMapT
+}
+
+func getEventTypeIdentifier(event SingularEventT) (eventType, eventIdentifier string) {
+	eventType, _ = event["type"].(string)
+	eventIdentifier, _ = event["event"].(string)
+	return
+}
+
+// getSchema reduces a flattened event to its schema: the Go type name of
+// each property path.
+func getSchema(flattenedEvent map[string]interface{}) map[string]string {
+	schema := make(map[string]string, len(flattenedEvent))
+	for key, value := range flattenedEvent {
+		schema[key] = fmt.Sprintf("%T", value)
+	}
+	return schema
+}
+
+// getSchemaHash hashes a schema's property paths and types, independent of
+// map iteration order, so the same shape always produces the same hash.
+func getSchemaHash(schema map[string]string) string {
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(schema[key]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handleEvent folds a single event into this manager's in-memory event
+// model and schema version maps, and observes its flattened property keys
+// in the frequency-counter registry for the resulting schemaHash.
+func (manager *EventSchemaManagerT) handleEvent(writeKey string, event SingularEventT) {
+	eventType, eventIdentifier := getEventTypeIdentifier(event)
+
+	flattenedEvent, err := flatten.Flatten(map[string]interface{}(event), "", flatten.DotStyle)
+	if err != nil {
+		return
+	}
+	schema := getSchema(flattenedEvent)
+	hash := getSchemaHash(schema)
+
+	eventModel := manager.getOrCreateEventModel(WriteKey(writeKey), eventType, eventIdentifier)
+	manager.getOrCreateSchemaVersion(eventModel.UUID, hash, schema)
+
+	for key := range schema {
+		observeFrequencyCounter(hash, key, fmt.Sprintf("%v", flattenedEvent[key]))
+	}
+}
+
+func (manager *EventSchemaManagerT) getOrCreateEventModel(writeKey WriteKey, eventType, eventIdentifier string) *EventModelT {
+	manager.eventModelMapLock.Lock()
+	defer manager.eventModelMapLock.Unlock()
+
+	if manager.eventModelMap == nil {
+		manager.eventModelMap = EventModelMapT{}
+	}
+	byType, ok := manager.eventModelMap[writeKey]
+	if !ok {
+		byType = make(map[string]map[string]*EventModelT)
+		manager.eventModelMap[writeKey] = byType
+	}
+	byIdentifier, ok := byType[eventType]
+	if !ok {
+		byIdentifier = make(map[string]*EventModelT)
+		byType[eventType] = byIdentifier
+	}
+	eventModel, ok := byIdentifier[eventIdentifier]
+	if !ok {
+		eventModel = &EventModelT{
+			UUID:            uuid.New().String(),
+			WriteKey:        writeKey,
+			EventType:       eventType,
+			EventIdentifier: eventIdentifier,
+		}
+		byIdentifier[eventIdentifier] = eventModel
+	}
+	return eventModel
+}
+
+func (manager *EventSchemaManagerT) getOrCreateSchemaVersion(eventModelID, hash string, schema map[string]string) *SchemaVersionT {
+	manager.schemaVersionMapLock.Lock()
+	defer manager.schemaVersionMapLock.Unlock()
+
+	if manager.schemaVersionMap == nil {
+		manager.schemaVersionMap = SchemaVersionMapT{}
+	}
+	versions, ok := manager.schemaVersionMap[eventModelID]
+	if !ok {
+		versions = make(map[string]*SchemaVersionT)
+		manager.schemaVersionMap[eventModelID] = versions
+	}
+	version, ok := versions[hash]
+	if !ok {
+		schemaJSON, _ := json.Marshal(schema)
+		version = &SchemaVersionT{
+			UUID:         uuid.New().String(),
+			EventModelID: eventModelID,
+			SchemaHash:   hash,
+			Schema:       schemaJSON,
+		}
+		versions[hash] = version
+	}
+	return version
+}
+
+// schemaHashesForEventModel returns every schemaHash currently observed for
+// eventModelID, i.e. the keys of its entry in schemaVersionMap. Frequency
+// counters are tracked per schemaHash (see handleEvent), not per event
+// model, so pendingUpserts must go through this indirection to find them.
+func (manager *EventSchemaManagerT) schemaHashesForEventModel(eventModelID string) []string {
+	manager.schemaVersionMapLock.RLock()
+	defer manager.schemaVersionMapLock.RUnlock()
+
+	versions := manager.schemaVersionMap[eventModelID]
+	hashes := make([]string, 0, len(versions))
+	for hash := range versions {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// eventModelUpsert is a single event model's flush-ready row: the bounded
+// frequency counters already marshalled to the private_data JSON column.
+type eventModelUpsert struct {
+	uuid            string
+	writeKey        string
+	eventType       string
+	eventIdentifier string
+	privateData     []byte
+}
+
+// pendingUpserts snapshots every event model this manager currently holds
+// in memory into flush-ready rows, without touching the DB.
+func (manager *EventSchemaManagerT) pendingUpserts() ([]eventModelUpsert, error) {
+	manager.eventModelMapLock.RLock()
+	var eventModels []*EventModelT
+	for _, byType := range manager.eventModelMap {
+		for _, byIdentifier := range byType {
+			for _, eventModel := range byIdentifier {
+				eventModels = append(eventModels, eventModel)
+			}
+		}
+	}
+	manager.eventModelMapLock.RUnlock()
+
+	upserts := make([]eventModelUpsert, 0, len(eventModels))
+	for _, eventModel := range eventModels {
+		var frequencyCounters []*FrequencyCounter
+		for _, hash := range manager.schemaHashesForEventModel(eventModel.UUID) {
+			frequencyCounters = append(frequencyCounters, getAllFrequencyCounters(hash)...)
+		}
+		privateData := PrivateDataT{FrequencyCounters: frequencyCounters}
+		privateDataJSON, err := json.Marshal(privateData)
+		if err != nil {
+			return nil, fmt.Errorf("[EventSchema] unable to marshal private data for %s: %w", eventModel.UUID, err)
+		}
+		upserts = append(upserts, eventModelUpsert{
+			uuid:            eventModel.UUID,
+			writeKey:        string(eventModel.WriteKey),
+			eventType:       eventModel.EventType,
+			eventIdentifier: eventModel.EventIdentifier,
+			privateData:     privateDataJSON,
+		})
+	}
+	return upserts, nil
+}
+
+// flushEventSchemasToDB persists every event model this manager currently
+// holds in memory, along with its bounded frequency counters, in a single
+// DB transaction.
+func (manager *EventSchemaManagerT) flushEventSchemasToDB() error {
+	upserts, err := manager.pendingUpserts()
+	if err != nil {
+		return err
+	}
+
+	txn, err := manager.dbHandle.Begin()
+	if err != nil {
+		return fmt.Errorf("[EventSchema] unable to begin transaction for flush: %w", err)
+	}
+	if err := execUpserts(txn, upserts); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+func execUpserts(txn *sql.Tx, upserts []eventModelUpsert) error {
+	for _, u := range upserts {
+		if _, err := txn.Exec(
+			`INSERT INTO event_models (uuid, write_key, event_type, event_identifier, private_data)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (uuid) DO UPDATE SET private_data = $5`,
+			u.uuid, u.writeKey, u.eventType, u.eventIdentifier, u.privateData,
+		); err != nil {
+			return fmt.Errorf("[EventSchema] unable to upsert event model %s: %w", u.uuid, err)
+		}
+	}
+	return nil
+}
+
+// Init performs event_schema package setup. It doesn't have anything to
+// reset at startup: the in-memory counters registry starts out empty in a
+// fresh process, so there is nothing yet to sweep here. Per-schemaHash
+// gauges are instead reset from populateFrequencyCountersBounded (see
+// resetSchemaMetrics in metrics.go), the one place this process actually
+// knows a schemaHash's in-memory counters just changed wholesale.
+func Init() {}
+
+// Init2 loads event_schema's own config once config.Load has run.
+func Init2() {}
@@ -142,7 +142,10 @@ func TestHandleEventBoundsFrequencyCounter(t *testing.T) {
 	// reload the models from the database which should now respect
 	// that frequency counters have now been bounded.
 	manager.handleEvent(writeKey, eventPayload.Batch[0])
-	require.Equal(t, len(countersCache[eventModel.UUID]), 3)
+	eventMap := map[string]interface{}(eventPayload.Batch[0])
+	flattenedEvent, _ := flatten.Flatten(eventMap, "", flatten.DotStyle)
+	hash := getSchemaHash(getSchema(flattenedEvent))
+	require.Equal(t, len(getAllFrequencyCounters(hash)), 3)
 
 	// flush the events back to the database.
 	manager.flushEventSchemasToDB()
@@ -0,0 +1,101 @@
+package event_schema
+
+// frequencyCounterLimit bounds how many distinct keys are tracked per
+// schemaHash. Once a schemaHash has seen this many distinct keys, further
+// unseen keys are only admitted by evicting the least-frequent tracked key,
+// per the Space-Saving algorithm in getFrequencyCounterBounded.
+var frequencyCounterLimit = 100
+
+// frequencyValueThreshold is the minimum relative frequency a distinct value
+// of a key must reach before ItemsAboveThreshold surfaces it.
+const frequencyValueThreshold = 0.01
+
+// FrequencyCounter tracks how often a single key (an event-model property
+// path, e.g. "properties.label") has been observed for a schemaHash, along
+// with the relative frequency of its distinct values.
+//
+// It doubles as a Space-Saving summary entry: Count and Error are
+// maintained by getFrequencyCounterBounded to keep an approximate top-K of
+// the most frequent keys per schemaHash, and are persisted as part of
+// PrivateDataT so the summary survives a flush/reload cycle. Count-Error is
+// a guaranteed lower bound on the true number of times Name was observed.
+//
+// Count/Error are deliberately kept separate from ValueTotal, which is the
+// denominator ItemsAboveThreshold uses for its per-value frequencies.
+// Count is inherited (inflated) from the key this entry displaced on
+// eviction, so using it as ValueTotal's stand-in would dilute every
+// re-admitted key's value frequencies by however many phantom observations
+// it inherited. ValueTotal only ever grows via Observe, so it always
+// reflects genuine observations of this key's values since admission.
+type FrequencyCounter struct {
+	Name       string           `json:"name"`
+	Count      int64            `json:"count"`
+	Error      int64            `json:"error"`
+	ValueTotal int64            `json:"value_total"`
+	Values     map[string]int64 `json:"values"`
+}
+
+// CounterItemEntry is a single distinct value of a key, along with its
+// frequency relative to the total number of observations of that key,
+// capped at 1.
+type CounterItemEntry struct {
+	Key       string
+	Frequency float64
+}
+
+// NewFrequencyCounter creates a fresh counter for a key that has just been
+// admitted into a schemaHash's tracked set.
+func NewFrequencyCounter(name string) *FrequencyCounter {
+	return &FrequencyCounter{Name: name, Values: make(map[string]int64)}
+}
+
+// NewPeristedFrequencyCounter rebuilds an in-memory FrequencyCounter from
+// its persisted (DB) form. Count and Error travel with the persisted
+// counter, so the Space-Saving summary for the schemaHash picks up exactly
+// where it left off instead of restarting from zero after a restart.
+func NewPeristedFrequencyCounter(fc *FrequencyCounter) *FrequencyCounter {
+	if fc.Values == nil {
+		fc.Values = make(map[string]int64)
+	}
+	return fc
+}
+
+// Observe records one occurrence of value for this key.
+func (fc *FrequencyCounter) Observe(value string) {
+	fc.Values[value]++
+	fc.ValueTotal++
+}
+
+// clone returns a deep copy of fc, safe to hand to a caller outside the
+// shard lock that guards the original (see countersRegistry.Snapshot).
+func (fc *FrequencyCounter) clone() *FrequencyCounter {
+	values := make(map[string]int64, len(fc.Values))
+	for k, v := range fc.Values {
+		values[k] = v
+	}
+	return &FrequencyCounter{
+		Name:       fc.Name,
+		Count:      fc.Count,
+		Error:      fc.Error,
+		ValueTotal: fc.ValueTotal,
+		Values:     values,
+	}
+}
+
+// ItemsAboveThreshold returns the distinct values of this key whose relative
+// frequency (occurrences of the value / ValueTotal observations of the key)
+// meets frequencyValueThreshold.
+func (fc *FrequencyCounter) ItemsAboveThreshold() []CounterItemEntry {
+	entries := make([]CounterItemEntry, 0, len(fc.Values))
+	if fc.ValueTotal == 0 {
+		return entries
+	}
+
+	for value, count := range fc.Values {
+		freq := float64(count) / float64(fc.ValueTotal)
+		if freq >= frequencyValueThreshold {
+			entries = append(entries, CounterItemEntry{Key: value, Frequency: freq})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,61 @@
+package event_schema
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetFrequencyCounterBoundedRetainsTopKUnderZipf feeds a Zipfian
+// keyspace much larger than the bound through getFrequencyCounterBounded
+// and asserts that the keys retained after a flush/reload cycle are the
+// true top-K, which random map-order eviction cannot guarantee.
+func TestGetFrequencyCounterBoundedRetainsTopKUnderZipf(t *testing.T) {
+	const (
+		schemaHash = "zipf-schema"
+		bound      = 10
+		keyspace   = 500
+		samples    = 200000
+	)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, keyspace-1)
+	trueCounts := make(map[string]int64)
+	for i := 0; i < samples; i++ {
+		key := keyOf(zipf.Uint64())
+		getFrequencyCounterBounded(schemaHash, key, bound)
+		trueCounts[key]++
+	}
+
+	wantTopK := topKKeys(trueCounts, bound)
+
+	// Simulate a flush to PrivateDataT followed by a reload.
+	persisted := getAllFrequencyCounters(schemaHash)
+	populateFrequencyCountersBounded(schemaHash, persisted, bound)
+
+	gotKeys := make(map[string]bool, bound)
+	for _, fc := range getAllFrequencyCounters(schemaHash) {
+		gotKeys[fc.Name] = true
+	}
+
+	for _, key := range wantTopK {
+		require.Truef(t, gotKeys[key], "expected true top-%d key %q to survive flush/reload, got %v", bound, key, gotKeys)
+	}
+}
+
+func keyOf(i uint64) string {
+	return "key-" + strconv.FormatUint(i, 10)
+}
+
+func topKKeys(counts map[string]int64, k int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+	if len(keys) > k {
+		keys = keys[:k]
+	}
+	return keys
+}
@@ -0,0 +1,23 @@
+package event_schema
+
+import "github.com/rudderlabs/rudder-server/services/stats"
+
+const (
+	statCounterCardinality   = "event_schema.counter_cardinality"
+	statFrequencyCounterSize = "event_schema.frequency_counter_size"
+)
+
+// resetSchemaMetrics zeroes every gauge this package emits for schemaHash.
+// It's called from populateFrequencyCountersBounded whenever schemaHash's
+// in-memory counters are reloaded from the DB wholesale, so the gauges
+// reflect the freshly reloaded set instead of whatever a previous load
+// cycle left behind.
+//
+// Note this only ever zeroes the gauges - nothing in this package currently
+// sets them to the real cardinality/size values their names imply, so today
+// they read 0 at all times rather than tracking live state.
+func resetSchemaMetrics(schemaHash string) {
+	tags := map[string]string{"schemaHash": schemaHash}
+	stats.NewTaggedStat(statCounterCardinality, stats.GaugeType, tags).Gauge(0)
+	stats.NewTaggedStat(statFrequencyCounterSize, stats.GaugeType, tags).Gauge(0)
+}
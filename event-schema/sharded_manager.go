@@ -0,0 +1,162 @@
+package event_schema
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// shardIndex hashes the triple that identifies an event model so that
+// every event for the same model always lands on the same shard. That
+// guarantee is what lets each shard's EventSchemaManagerT own its slice of
+// eventModelMap/schemaVersionMap without contention on the ingestion hot
+// path: only that shard's worker takes its map locks while ingesting, and
+// distinct models are processed by distinct shards in parallel.
+func shardIndex(writeKey, eventType, eventIdentifier string, shardCount int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(writeKey))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(eventType))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(eventIdentifier))
+	return int(h.Sum32() % uint32(shardCount))
+}
+
+type shardedEvent struct {
+	writeKey string
+	event    SingularEventT
+}
+
+// eventSchemaShard pairs one EventSchemaManagerT with the inbound channel
+// its single worker goroutine drains. The manager is only ever mutated by
+// that one goroutine, so ingestion needs no locking beyond what
+// EventSchemaManagerT already does for concurrent readers like
+// flushEventSchemasToDB.
+type eventSchemaShard struct {
+	manager *EventSchemaManagerT
+	in      chan shardedEvent
+}
+
+// ShardedEventSchemaManagerT replaces handleEvent's single-goroutine
+// ingestion with a worker pool: Submit hashes writeKey+eventType+
+// eventIdentifier into one of several shards, each owning its own
+// EventSchemaManagerT, goroutine, and inbound channel, so that events for a
+// given event model are always handled by the same worker (so shards don't
+// contend for each other's map locks on the hot path) while distinct models
+// are processed in parallel.
+type ShardedEventSchemaManagerT struct {
+	shards []*eventSchemaShard
+	wg     sync.WaitGroup
+}
+
+// Factory constructs a ShardedEventSchemaManagerT with a configurable shard
+// count and per-shard inbound channel depth.
+type Factory struct {
+	DBHandle             *sql.DB
+	DisableInMemoryCache bool
+	ShardCount           int
+	ChannelDepth         int
+}
+
+// New builds and starts a ShardedEventSchemaManagerT backed by f.ShardCount
+// workers, each owning its own EventSchemaManagerT.
+func (f *Factory) New() *ShardedEventSchemaManagerT {
+	shardCount := f.ShardCount
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+	channelDepth := f.ChannelDepth
+	if channelDepth <= 0 {
+		channelDepth = 1
+	}
+
+	m := &ShardedEventSchemaManagerT{
+		shards: make([]*eventSchemaShard, shardCount),
+	}
+	for i := range m.shards {
+		s := &eventSchemaShard{
+			manager: &EventSchemaManagerT{
+				dbHandle:             f.DBHandle,
+				disableInMemoryCache: f.DisableInMemoryCache,
+				eventModelMap:        EventModelMapT{},
+				schemaVersionMap:     SchemaVersionMapT{},
+			},
+			in: make(chan shardedEvent, channelDepth),
+		}
+		m.shards[i] = s
+		m.wg.Add(1)
+		go m.run(s)
+	}
+	return m
+}
+
+func (m *ShardedEventSchemaManagerT) run(s *eventSchemaShard) {
+	defer m.wg.Done()
+	for e := range s.in {
+		s.manager.handleEvent(e.writeKey, e.event)
+	}
+}
+
+// Submit non-blockingly enqueues event onto the shard owning its event
+// model, returning an error rather than blocking the caller if that
+// shard's channel is full.
+func (m *ShardedEventSchemaManagerT) Submit(writeKey string, event SingularEventT) error {
+	eventType, eventIdentifier := getEventTypeIdentifier(event)
+	idx := shardIndex(writeKey, eventType, eventIdentifier, len(m.shards))
+	select {
+	case m.shards[idx].in <- shardedEvent{writeKey: writeKey, event: event}:
+		return nil
+	default:
+		return fmt.Errorf("event_schema: shard %d is full, dropping event for %s/%s/%s", idx, writeKey, eventType, eventIdentifier)
+	}
+}
+
+// Close stops accepting new events and waits for every shard's worker to
+// drain its channel. Submit must not be called after Close.
+func (m *ShardedEventSchemaManagerT) Close() {
+	for _, s := range m.shards {
+		close(s.in)
+	}
+	m.wg.Wait()
+}
+
+// flushEventSchemasToDB fans the flush out across every shard concurrently
+// - each shard only needs to read its own maps - and concatenates every
+// shard's upserts into a single DB transaction, so the flush is
+// all-or-nothing across the whole manager rather than per shard.
+func (m *ShardedEventSchemaManagerT) flushEventSchemasToDB() error {
+	results := make([][]eventModelUpsert, len(m.shards))
+	errs := make([]error, len(m.shards))
+
+	var wg sync.WaitGroup
+	wg.Add(len(m.shards))
+	for i, s := range m.shards {
+		go func(i int, s *eventSchemaShard) {
+			defer wg.Done()
+			results[i], errs[i] = s.manager.pendingUpserts()
+		}(i, s)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	var upserts []eventModelUpsert
+	for _, r := range results {
+		upserts = append(upserts, r...)
+	}
+
+	txn, err := m.shards[0].manager.dbHandle.Begin()
+	if err != nil {
+		return fmt.Errorf("[EventSchema] unable to begin transaction for flush: %w", err)
+	}
+	if err := execUpserts(txn, upserts); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
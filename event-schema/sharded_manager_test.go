@@ -0,0 +1,56 @@
+package event_schema
+
+import (
+	"fmt"
+	"testing"
+)
+
+func benchmarkEvents(n int) []shardedEvent {
+	events := make([]shardedEvent, n)
+	for i := range events {
+		events[i] = shardedEvent{
+			writeKey: fmt.Sprintf("write-key-%d", i%8),
+			event: SingularEventT{
+				"type":  "track",
+				"event": fmt.Sprintf("event-%d", i%32),
+				"properties": map[string]interface{}{
+					"label": fmt.Sprintf("value-%d", i%100),
+				},
+			},
+		}
+	}
+	return events
+}
+
+// BenchmarkEventSchemaHandleEventSerial is the single-goroutine baseline:
+// every event is folded into one EventSchemaManagerT's maps on the calling
+// goroutine.
+func BenchmarkEventSchemaHandleEventSerial(b *testing.B) {
+	events := benchmarkEvents(b.N)
+	manager := &EventSchemaManagerT{eventModelMap: EventModelMapT{}, schemaVersionMap: SchemaVersionMapT{}}
+
+	b.ResetTimer()
+	for _, e := range events {
+		manager.handleEvent(e.writeKey, e.event)
+	}
+}
+
+// BenchmarkEventSchemaHandleEventSharded compares throughput against the
+// serial baseline across 1/4/16 shards.
+func BenchmarkEventSchemaHandleEventSharded(b *testing.B) {
+	for _, shardCount := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shardCount), func(b *testing.B) {
+			events := benchmarkEvents(b.N)
+			factory := Factory{ShardCount: shardCount, ChannelDepth: 1024}
+			manager := factory.New()
+
+			b.ResetTimer()
+			for _, e := range events {
+				for manager.Submit(e.writeKey, e.event) != nil {
+					// backpressure: retry until a worker drains the shard.
+				}
+			}
+			manager.Close()
+		})
+	}
+}
@@ -1,62 +1,141 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 )
 
+// PlanMode controls whether handleQueryExecution captures the query's
+// execution plan before running it, and how.
+type PlanMode int
+
+const (
+	// PlanNone runs the query as-is, with no plan collection.
+	PlanNone PlanMode = iota
+	// PlanExplain logs a plain-text EXPLAIN of the query.
+	PlanExplain
+	// PlanExplainAnalyze runs EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON)
+	// inside the caller's transaction when one is set, so the plan
+	// collection itself is rolled back along with everything else on
+	// failure (with only a db set, it runs outside any transaction), and hands the
+	// resulting JSON plan to planSink for downstream stats emission
+	// (planning/execution time, rows, shared buffers hit/read).
+	PlanExplainAnalyze
+)
+
 type QueryExecution struct {
-	txn                 *sql.Tx
-	db                  *sql.DB
-	query               string
-	enableWithQueryPlan bool
+	ctx      context.Context
+	txn      *sql.Tx
+	db       *sql.DB
+	query    string
+	planMode PlanMode
+	planSink func(planJSON []byte)
 }
 
 // handleQueryExecution
-// Print execution plan if enableWithQueryPlan is set to true else return result set.
+// Collects the execution plan per e.planMode (none, plain-text EXPLAIN, or
+// EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) handed to e.planSink) and then
+// runs e.query, honouring e.ctx for cancellation throughout. With
+// PlanExplainAnalyze the EXPLAIN ANALYZE is itself the execution: e.query
+// is not run again and the returned sql.Result is nil.
 // Currently, these statements are supported by EXPLAIN ANALYZE
 // Any SELECT, INSERT, UPDATE, DELETE, VALUES, EXECUTE, DECLARE, CREATE TABLE AS, or CREATE MATERIALIZED VIEW AS statement, whose execution plan you wish to see.
 func handleQueryExecution(e *QueryExecution) (result sql.Result, err error) {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	sqlStatement := e.query
 
-	if e.enableWithQueryPlan {
-		sqlStatement = "EXPLAIN " + e.query
-
-		var rows *sql.Rows
-		if e.txn != nil {
-			rows, err = e.txn.Query(sqlStatement)
-		} else if e.db != nil {
-			rows, err = e.db.Query(sqlStatement)
-		} else {
-			err = fmt.Errorf("[WH][POSTGRES] Not able to handle query execution for statement: %s as both txn and db are nil", sqlStatement)
-			return
-		}
-		if err != nil {
-			err = fmt.Errorf("[WH][POSTGRES] error occurred while handling transaction for query: %s with err: %w", sqlStatement, err)
-			return
+	if e.planMode == PlanExplain {
+		if err = logQueryPlan(ctx, e); err != nil {
+			return nil, err
 		}
-		defer rows.Close()
-
-		var response []string
-		for rows.Next() {
-			var s string
-			if err = rows.Scan(&s); err != nil {
-				err = fmt.Errorf("[WH][POSTGRES] Error occurred while processing destination revisionID query %+v with err: %w", e, err)
-				return
-			}
-			response = append(response, s)
-		}
-		pkgLogger.Infof(fmt.Sprintf(`[WH][POSTGRES] Execution Query plan for statement: %s is %s`, sqlStatement, strings.Join(response, `
-`)))
 	}
+
+	if e.planMode == PlanExplainAnalyze {
+		// EXPLAIN (ANALYZE, ...) itself executes sqlStatement, so capturing
+		// it *is* the execution - falling through to ExecContext below
+		// would run an INSERT/UPDATE/DELETE/CREATE-AS statement a second
+		// time. There's no sql.Result to hand back from a Query call;
+		// callers that need one should use PlanExplain or PlanNone.
+		return nil, captureQueryPlan(ctx, e)
+	}
+
 	if e.txn != nil {
-		result, err = e.txn.Exec(sqlStatement)
+		result, err = e.txn.ExecContext(ctx, sqlStatement)
 	} else if e.db != nil {
-		result, err = e.db.Exec(sqlStatement)
+		result, err = e.db.ExecContext(ctx, sqlStatement)
 	} else {
 		err = fmt.Errorf("[WH][POSTGRES] Not able to handle query execution for statement: %s as both txn and db are nil", sqlStatement)
 		return
 	}
 	return
 }
+
+// logQueryPlan runs a plain-text EXPLAIN of e.query and logs it.
+func logQueryPlan(ctx context.Context, e *QueryExecution) error {
+	sqlStatement := "EXPLAIN " + e.query
+
+	rows, err := queryContext(ctx, e, sqlStatement)
+	if err != nil {
+		return fmt.Errorf("[WH][POSTGRES] error occurred while handling transaction for query: %s with err: %w", sqlStatement, err)
+	}
+	defer rows.Close()
+
+	var response []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return fmt.Errorf("[WH][POSTGRES] Error occurred while processing destination revisionID query %+v with err: %w", e, err)
+		}
+		response = append(response, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	pkgLogger.Infof(fmt.Sprintf(`[WH][POSTGRES] Execution Query plan for statement: %s is %s`, sqlStatement, strings.Join(response, `
+`)))
+	return nil
+}
+
+// captureQueryPlan runs EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) for e.query
+// inside the caller's transaction (if any) and passes the resulting JSON
+// plan to e.planSink.
+func captureQueryPlan(ctx context.Context, e *QueryExecution) error {
+	sqlStatement := "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) " + e.query
+
+	rows, err := queryContext(ctx, e, sqlStatement)
+	if err != nil {
+		return fmt.Errorf("[WH][POSTGRES] error occurred while collecting query plan for statement: %s with err: %w", sqlStatement, err)
+	}
+	defer rows.Close()
+
+	var planJSON []byte
+	if rows.Next() {
+		if err := rows.Scan(&planJSON); err != nil {
+			return fmt.Errorf("[WH][POSTGRES] error occurred while scanning query plan for statement: %s with err: %w", sqlStatement, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if e.planSink != nil && planJSON != nil {
+		e.planSink(planJSON)
+	}
+	return nil
+}
+
+func queryContext(ctx context.Context, e *QueryExecution, sqlStatement string) (*sql.Rows, error) {
+	if e.txn != nil {
+		return e.txn.QueryContext(ctx, sqlStatement)
+	}
+	if e.db != nil {
+		return e.db.QueryContext(ctx, sqlStatement)
+	}
+	return nil, fmt.Errorf("[WH][POSTGRES] Not able to handle query execution for statement: %s as both txn and db are nil", sqlStatement)
+}